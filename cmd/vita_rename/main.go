@@ -0,0 +1,713 @@
+// Command vita_rename renames PS Vita game dumps (zip archives, tarballs,
+// or extracted directories) based on the metadata in their param.sfo.
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/spf13/afero"
+
+	"github.com/oprietop/vita_rename/sfo"
+)
+
+// defaultNameTemplate reproduces the tool's historical naming convention.
+const defaultNameTemplate = `{{.Title}} ({{.AppVer}}-{{.Version}}-{{.AC}}) [{{.TitleID}}] ({{.Region}}){{.Ext}}`
+
+// defaultInclude is the set of containers discovered when -include isn't given.
+var defaultInclude = []string{"*.zip", "*.tar", "*.tar.gz", "*.tgz"}
+
+// NameData is the info gathered from a container's param.sfo(s) that we
+// use to build the renamed filename and manifest entry.
+type NameData struct {
+	title, appVer, version, titleId, region string
+	ac                                      int
+	sfo                                     map[string]string
+}
+
+// sfoSource abstracts over the different container formats (zip archives,
+// tarballs, and plain directories) that may hold one or more param.sfo
+// files, so the rename logic can stay oblivious to the container format.
+type sfoSource interface {
+	// sfoReaders returns a ReadCloser for every param.sfo found in the
+	// container, in no particular order. Callers must close each one.
+	sfoReaders() ([]io.ReadCloser, error)
+	// ext is the filename extension (including the leading dot, if any)
+	// to use when building the renamed target.
+	ext() string
+	// rename moves the underlying container to newName.
+	rename(newName string) error
+	// hash returns the hex-encoded SHA256 of the container's raw bytes,
+	// or "" for sources (like a directory) with no single blob to hash.
+	hash() string
+	// close releases any resource held open by the source.
+	close() error
+}
+
+// newSfoSource inspects path and returns the sfoSource implementation that
+// knows how to read it: a directory, a zip archive, or a (possibly
+// gzipped) tarball. All file access goes through fsys so callers can point
+// it at the real disk, an in-memory filesystem, or a read-only overlay.
+// needHash controls whether the source eagerly computes a SHA256 of the
+// container: that requires a full streaming read of potentially several
+// GB, so callers should only ask for it when a manifest is actually
+// being written.
+func newSfoSource(fsys afero.Fs, path string, needHash bool) (sfoSource, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dirSource{fsys: fsys, path: path}, nil
+	}
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return newZipSource(fsys, path, needHash)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return newTarSource(fsys, path, true, needHash)
+	case strings.HasSuffix(path, ".tar"):
+		return newTarSource(fsys, path, false, needHash)
+	}
+	// The extension didn't match a known container suffix: dumps are
+	// routinely shared under other extensions (e.g. .vpk, which is just
+	// a zip), so sniff the magic bytes before giving up on them.
+	switch kind, err := sniffContainer(fsys, path); {
+	case err != nil:
+		return nil, err
+	case kind == containerZip:
+		return newZipSource(fsys, path, needHash)
+	case kind == containerTarGz:
+		return newTarSource(fsys, path, true, needHash)
+	case kind == containerTar:
+		return newTarSource(fsys, path, false, needHash)
+	}
+	return nil, fmt.Errorf("unsupported container: %s", path)
+}
+
+// Container kinds identified by sniffContainer.
+const (
+	containerZip   = "zip"
+	containerTarGz = "tar.gz"
+	containerTar   = "tar"
+)
+
+// sniffContainer identifies a container format from its leading bytes,
+// for paths whose extension newSfoSource doesn't otherwise recognize. It
+// returns "" if the bytes don't match any known format.
+func sniffContainer(fsys afero.Fs, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var header [262]byte
+	n, err := io.ReadFull(f, header[:])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	data := header[:n]
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return containerZip, nil
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return containerTarGz, nil
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return containerTar, nil
+	}
+	return "", nil
+}
+
+// hashFile streams path through SHA256 without holding it in memory, so
+// hashing a multi-GB dump doesn't require buffering it whole.
+func hashFile(fsys afero.Fs, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// closeReaders closes every reader already opened by a sfoReaders call
+// that is about to fail partway through, so callers bailing out on an
+// error don't leak the file descriptors opened so far.
+func closeReaders(readers []io.ReadCloser) {
+	for _, rc := range readers {
+		rc.Close()
+	}
+}
+
+// zipSource reads param.sfo entries out of a zip archive. f is kept open
+// for the source's lifetime: zip.Reader reads entries lazily through it
+// rather than from a fully buffered copy, so opening a multi-GB archive
+// doesn't require holding it in memory.
+type zipSource struct {
+	fsys      afero.Fs
+	path      string
+	sha       string
+	f         afero.File
+	r         *zip.Reader
+	extension string
+}
+
+func newZipSource(fsys afero.Fs, path string, needHash bool) (*zipSource, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var sha string
+	if needHash {
+		if sha, err = hashFile(fsys, path); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &zipSource{fsys: fsys, path: path, sha: sha, f: f, r: r, extension: zipExt(path)}, nil
+}
+
+// zipExt preserves the container's own suffix (e.g. a sniffed ".vpk"
+// input stays ".vpk" rather than becoming ".zip") and only falls back
+// to ".zip" for paths with no extension of their own.
+func zipExt(path string) string {
+	if ext := filepath.Ext(path); ext != "" {
+		return ext
+	}
+	return ".zip"
+}
+
+func (s *zipSource) sfoReaders() ([]io.ReadCloser, error) {
+	var readers []io.ReadCloser
+	for _, f := range s.r.File {
+		if filepath.Base(f.Name) != "param.sfo" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			closeReaders(readers)
+			return nil, err
+		}
+		readers = append(readers, rc)
+	}
+	return readers, nil
+}
+
+func (s *zipSource) ext() string { return s.extension }
+
+func (s *zipSource) rename(newName string) error { return s.fsys.Rename(s.path, newName) }
+
+func (s *zipSource) hash() string { return s.sha }
+
+func (s *zipSource) close() error { return s.f.Close() }
+
+// tarSource reads param.sfo entries out of a tarball, optionally gzipped.
+// Unlike zipSource it doesn't keep a file open between calls: a tarball
+// can only be read forward, so sfoReaders opens its own stream each time
+// rather than buffering the whole archive in memory.
+type tarSource struct {
+	fsys      afero.Fs
+	path      string
+	gzipped   bool
+	sha       string
+	extension string
+}
+
+func newTarSource(fsys afero.Fs, path string, gzipped bool, needHash bool) (*tarSource, error) {
+	if _, err := fsys.Stat(path); err != nil {
+		return nil, err
+	}
+	var sha string
+	if needHash {
+		var err error
+		if sha, err = hashFile(fsys, path); err != nil {
+			return nil, err
+		}
+	}
+	return &tarSource{fsys: fsys, path: path, gzipped: gzipped, sha: sha, extension: tarExt(path, gzipped)}, nil
+}
+
+// tarExt preserves the container's own suffix (e.g. a ".tgz" input stays
+// ".tgz" rather than becoming ".tar.gz") and only falls back to a
+// canonical extension when path doesn't already carry a recognized one.
+func tarExt(path string, gzipped bool) string {
+	switch {
+	case strings.HasSuffix(path, ".tgz"):
+		return ".tgz"
+	case strings.HasSuffix(path, ".tar.gz"):
+		return ".tar.gz"
+	case strings.HasSuffix(path, ".tar"):
+		return ".tar"
+	case gzipped:
+		return ".tar.gz"
+	default:
+		return ".tar"
+	}
+}
+
+func (s *tarSource) sfoReaders() ([]io.ReadCloser, error) {
+	f, err := s.fsys.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if s.gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var readers []io.ReadCloser
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closeReaders(readers)
+			return nil, err
+		}
+		if filepath.Base(hdr.Name) != "param.sfo" {
+			continue
+		}
+		// tar.Reader only reads forward, so buffer the (small) param.sfo
+		// entry now; the surrounding archive itself is still streamed.
+		buf, err := io.ReadAll(tr)
+		if err != nil {
+			closeReaders(readers)
+			return nil, err
+		}
+		readers = append(readers, io.NopCloser(bytes.NewReader(buf)))
+	}
+	return readers, nil
+}
+
+func (s *tarSource) ext() string { return s.extension }
+
+func (s *tarSource) rename(newName string) error { return s.fsys.Rename(s.path, newName) }
+
+func (s *tarSource) hash() string { return s.sha }
+
+func (s *tarSource) close() error { return nil }
+
+// dirSource reads param.sfo entries out of an already-extracted directory
+// tree; the rename targets the directory itself.
+type dirSource struct {
+	fsys afero.Fs
+	path string
+}
+
+func (s *dirSource) sfoReaders() ([]io.ReadCloser, error) {
+	var readers []io.ReadCloser
+	err := afero.Walk(s.fsys, s.path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Base(p) != "param.sfo" {
+			return nil
+		}
+		f, err := s.fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, f)
+		return nil
+	})
+	if err != nil {
+		closeReaders(readers)
+		return nil, err
+	}
+	return readers, nil
+}
+
+func (s *dirSource) ext() string { return "" }
+
+func (s *dirSource) rename(newName string) error { return s.fsys.Rename(s.path, newName) }
+
+// hash is unset for directories: there is no single blob to checksum.
+func (s *dirSource) hash() string { return "" }
+
+func (s *dirSource) close() error { return nil }
+
+// nameTemplateData is what a -name-template can substitute: the same
+// fields vita_rename has always used to build its filenames, plus the
+// raw SFO map for anyone who wants a key the built-ins don't expose.
+type nameTemplateData struct {
+	Title, AppVer, Version, TitleID, Region, Ext string
+	AC                                           int
+	SFO                                          map[string]string
+}
+
+// buildName executes tmpl against data, sanitizing every substituted
+// value so a malicious or merely weird SFO can't produce a path that
+// escapes the target directory or breaks the filesystem.
+func buildName(tmpl *template.Template, data NameData, ext string) (string, error) {
+	sfoValues := make(map[string]string, len(data.sfo))
+	for k, v := range data.sfo {
+		sfoValues[k] = sfo.SafeString(v)
+	}
+	td := nameTemplateData{
+		Title:   sfo.SafeString(data.title),
+		AppVer:  sfo.SafeString(data.appVer),
+		Version: sfo.SafeString(data.version),
+		TitleID: sfo.SafeString(data.titleId),
+		Region:  sfo.SafeString(data.region),
+		Ext:     ext,
+		AC:      data.ac,
+		SFO:     sfoValues,
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, td); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// process a single container (zip, tar/tar.gz, or extracted directory).
+// renamed reports whether the container was actually renamed (or would
+// have been, under dryRun); rec is the manifest entry for the rename, or
+// nil if nothing was renamed; err is non-nil if the container could not
+// be processed at all.
+func task(ctx context.Context, fsys afero.Fs, dryRun bool, tmpl *template.Template, renameMu *sync.Mutex, needHash bool, file string) (renamed bool, rec *manifestRecord, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, nil, err
+	}
+
+	src, err := newSfoSource(fsys, file, needHash)
+	if err != nil {
+		return false, nil, err
+	}
+	defer src.close()
+
+	readers, err := src.sfoReaders()
+	if err != nil {
+		return false, nil, err
+	}
+
+	// init vars
+	data := NameData{sfo: map[string]string{}}
+	for _, rc := range readers {
+		if err := ctx.Err(); err != nil {
+			rc.Close()
+			return false, nil, err
+		}
+		f, err := sfo.Parse(rc)
+		rc.Close()
+		if err != nil {
+			return false, nil, err
+		}
+		if f.Category() == "ac" {
+			data.ac++
+		}
+		// The manifest records every SFO key/value pair discovered, not
+		// just the ones from the SFO picked for naming (a base game plus
+		// add-on content each carry their own param.sfo).
+		for k, v := range f.All() {
+			data.sfo[k] = v
+		}
+		// valid SFOs to take into account for naming are the ones with an APP_VER key
+		if appVer, ok := f.Get("APP_VER"); ok {
+			// update variables, we want to know the higher version
+			if appVer > data.appVer {
+				data.appVer = appVer
+			}
+			if version, _ := f.Get("VERSION"); version > data.version {
+				data.version = version
+			}
+			// keep the info we want
+			title, _ := f.Get("TITLE")
+			titleId, _ := f.Get("TITLE_ID")
+			data.title, data.titleId, data.region = title, titleId, f.Region()
+		}
+	}
+
+	// Nothing worth renaming: not an error, just skipped.
+	if data.title == "" {
+		return false, nil, nil
+	}
+
+	// generate a newName candidate, preserving the source extension
+	name, err := buildName(tmpl, data, src.ext())
+	if err != nil {
+		return false, nil, fmt.Errorf("%s: name-template: %w", file, err)
+	}
+	// Keep the rename alongside the original: file may be nested several
+	// directories below -root, and newName must not flatten that layout
+	// (or collide with a same-titled dump discovered under another dir).
+	newName := filepath.Join(filepath.Dir(file), name)
+	// The existence check and the rename itself must be atomic as a pair,
+	// or two workers deriving the same newName (e.g. duplicate USA/EUR
+	// dumps) could both pass the check and the second rename would
+	// silently overwrite the first.
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	// Check if our target file does not exists
+	if _, err := fsys.Stat(newName); !os.IsNotExist(err) {
+		return false, nil, fmt.Errorf("%s: target %q already exists", file, newName)
+	}
+
+	rec = &manifestRecord{Original: file, New: newName, Region: data.region, SHA256: src.hash(), SFO: data.sfo}
+
+	if dryRun {
+		fmt.Printf("Would move '\033[36m%s\033[39m' to '\033[33m%s\033[39m'\n", file, newName)
+		return true, rec, nil
+	}
+
+	if err := src.rename(newName); err != nil {
+		return false, nil, err
+	}
+	fmt.Printf("Moving '\033[36m%s\033[39m' to '\033[33m%s\033[39m': \033[32mOK!\033[39m\n", file, newName)
+	return true, rec, nil
+}
+
+// discover walks root recursively looking for containers: any file
+// matching an include pattern (and no exclude pattern), plus any
+// directory that has a param.sfo somewhere below it, in which case the
+// whole directory is treated as one container and not descended into.
+func discover(fsys afero.Fs, root string, include, exclude []string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(afero.NewIOFS(fsys), root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if matchAny(exclude, p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			has, err := containsParamSfo(fsys, p)
+			if err != nil {
+				return err
+			}
+			if has {
+				files = append(files, p)
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if matchAny(include, p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchGlob reports whether pattern matches relPath. A pattern containing
+// "/" is matched against the full relative path; otherwise it's matched
+// against the base name. A pattern ending in "/**" matches anything
+// under that directory prefix (path.Match has no "**" support).
+func matchGlob(pattern, relPath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return relPath == prefix || strings.HasPrefix(relPath, prefix+"/")
+	}
+	if strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, relPath)
+		return ok
+	}
+	ok, _ := path.Match(pattern, filepath.Base(relPath))
+	return ok
+}
+
+func matchAny(patterns []string, relPath string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// errFound stops an afero.Walk early once a param.sfo has been seen.
+var errFound = errors.New("param.sfo found")
+
+// containsParamSfo reports whether dir has a param.sfo anywhere below it.
+func containsParamSfo(fsys afero.Fs, dir string) (bool, error) {
+	found := false
+	err := afero.Walk(fsys, dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Base(p) == "param.sfo" {
+			found = true
+			return errFound
+		}
+		return nil
+	})
+	if err == errFound {
+		err = nil
+	}
+	return found, err
+}
+
+// splitPatterns parses a comma-separated glob list from a flag value.
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// outcome carries a single task's result back to the main goroutine.
+type outcome struct {
+	file    string
+	renamed bool
+	rec     *manifestRecord
+	err     error
+}
+
+func main() {
+	workers := flag.Int("j", runtime.NumCPU(), "number of concurrent workers")
+	root := flag.String("root", ".", "directory to scan for containers")
+	dryRun := flag.Bool("dry-run", false, "only print the renames that would happen")
+	manifestPath := flag.String("manifest", "", "write a rename manifest to this path (.json or .csv)")
+	include := flag.String("include", strings.Join(defaultInclude, ","), "comma-separated glob patterns of containers to scan for")
+	exclude := flag.String("exclude", "", "comma-separated glob patterns to skip, e.g. 'backup/**'")
+	nameTemplate := flag.String("name-template", defaultNameTemplate, "text/template used to build the renamed filename")
+	flag.Parse()
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	tmpl, err := template.New("name").Parse(*nameTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "name-template: %v\n", err)
+		os.Exit(1)
+	}
+
+	var fsys afero.Fs = afero.NewBasePathFs(afero.NewOsFs(), *root)
+	if *dryRun {
+		fsys = afero.NewReadOnlyFs(fsys)
+	}
+
+	var manifest manifestWriter
+	if *manifestPath != "" {
+		m, err := newManifestWriter(*manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "manifest: %v\n", err)
+			os.Exit(1)
+		}
+		manifest = m
+		defer manifest.close()
+	}
+
+	// Cancel in-flight work on SIGINT instead of leaving goroutines stuck
+	// mid-read against an archive nobody is waiting on anymore.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	files, err := discover(fsys, ".", splitPatterns(*include), splitPatterns(*exclude))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "discover: %v\n", err)
+		os.Exit(1)
+	}
+
+	jobs := make(chan string)
+	results := make(chan outcome)
+
+	// renameMu serializes the existence-check-then-rename step across
+	// workers so two containers that derive the same newName can't both
+	// pass the check and race each other into an overwrite.
+	var renameMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		// Pre-Add before the worker is launched, not inside it, so
+		// wg.Wait() can never return before every worker has started.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				renamed, rec, err := task(ctx, fsys, *dryRun, tmpl, &renameMu, manifest != nil, file)
+				select {
+				case results <- outcome{file: file, renamed: renamed, rec: rec, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, f := range files {
+			select {
+			case jobs <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var renamedN, skippedN, failedN int
+	for res := range results {
+		switch {
+		case res.err != nil:
+			failedN++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", res.file, res.err)
+		case res.renamed:
+			renamedN++
+			if manifest != nil && res.rec != nil {
+				if err := manifest.write(*res.rec); err != nil {
+					fmt.Fprintf(os.Stderr, "manifest: %v\n", err)
+				}
+			}
+		default:
+			skippedN++
+		}
+	}
+
+	fmt.Printf("%d renamed, %d skipped, %d failed\n", renamedN, skippedN, failedN)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/spf13/afero"
+)
+
+func testTemplate(t *testing.T) *template.Template {
+	t.Helper()
+	tmpl, err := template.New("name").Parse(defaultNameTemplate)
+	if err != nil {
+		t.Fatalf("parse default name template: %v", err)
+	}
+	return tmpl
+}
+
+// sfoHeader/sfoIndex mirror the on-disk SFO layout closely enough to build
+// a minimal, well-formed param.sfo for tests without reaching into the
+// sfo package's internals.
+type sfoHeader struct {
+	Magic, Version, KeyOffset, DataOffset, Entries int32
+}
+
+type sfoIndex struct {
+	KeyOffset, ParamFmt                     int16
+	ParamLength, ParamMaxLength, DataOffset int32
+}
+
+func buildParamSfo(t *testing.T, title, titleID, appVer string) []byte {
+	t.Helper()
+	return buildSfo(t, []struct{ key, value string }{
+		{"TITLE", title},
+		{"TITLE_ID", titleID},
+		{"APP_VER", appVer},
+		{"VERSION", appVer},
+	})
+}
+
+// buildAddonParamSfo builds a param.sfo like an add-on's: it carries its
+// own CONTENT_ID and CATEGORY but no APP_VER, so it's not a candidate
+// for naming but still contributes its keys to the manifest's SFO map.
+func buildAddonParamSfo(t *testing.T, contentID, category string) []byte {
+	t.Helper()
+	return buildSfo(t, []struct{ key, value string }{
+		{"CONTENT_ID", contentID},
+		{"CATEGORY", category},
+	})
+}
+
+func buildSfo(t *testing.T, entries []struct{ key, value string }) []byte {
+	t.Helper()
+	var keyTable bytes.Buffer
+	keyOffsets := make([]int32, len(entries))
+	for i, e := range entries {
+		keyOffsets[i] = int32(keyTable.Len())
+		keyTable.WriteString(e.key)
+		keyTable.WriteByte(0)
+	}
+	keyOffset := int32(20 + 16*len(entries))
+	dataOffset := keyOffset + int32(keyTable.Len())
+
+	var dataTable bytes.Buffer
+	indexes := make([]sfoIndex, len(entries))
+	for i, e := range entries {
+		indexes[i] = sfoIndex{
+			KeyOffset:      int16(keyOffsets[i]),
+			ParamFmt:       0x0204,
+			ParamLength:    int32(len(e.value)),
+			ParamMaxLength: int32(len(e.value)),
+			DataOffset:     int32(dataTable.Len()),
+		}
+		dataTable.WriteString(e.value)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, sfoHeader{
+		Magic: 1179865088, Version: 0x101, KeyOffset: keyOffset, DataOffset: dataOffset, Entries: int32(len(entries)),
+	})
+	for _, idx := range indexes {
+		binary.Write(&buf, binary.LittleEndian, idx)
+	}
+	buf.Write(keyTable.Bytes())
+	buf.Write(dataTable.Bytes())
+	return buf.Bytes()
+}
+
+func writeTestZip(t *testing.T, fsys afero.Fs, path string, sfoContents []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("game/sce_sys/param.sfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(sfoContents); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fsys, path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestZipMulti builds a zip with one param.sfo per entry in sfos,
+// keyed by its path inside the archive, for containers that bundle a
+// base game alongside add-on content.
+func writeTestZipMulti(t *testing.T, fsys afero.Fs, path string, sfos map[string][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for entryPath, contents := range sfos {
+		w, err := zw.Create(entryPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fsys, path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTaskRenamesZip(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "game.zip", buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"))
+
+	renamed, rec, err := task(context.Background(), fsys, false, testTemplate(t), &sync.Mutex{}, true, "game.zip")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if !renamed {
+		t.Fatal("task: want renamed=true")
+	}
+
+	want := "Gravity Rush (01.00-01.00-0) [PCSA00042] (USA).zip"
+	if ok, _ := afero.Exists(fsys, want); !ok {
+		t.Fatalf("expected renamed file %q to exist", want)
+	}
+	if ok, _ := afero.Exists(fsys, "game.zip"); ok {
+		t.Fatal("original game.zip should no longer exist")
+	}
+
+	if rec == nil {
+		t.Fatal("task: want a manifest record")
+	}
+	if rec.Original != "game.zip" || rec.New != want || rec.Region != "USA" {
+		t.Errorf("task: unexpected manifest record %+v", rec)
+	}
+	if rec.SHA256 == "" {
+		t.Error("task: manifest record missing SHA256")
+	}
+	if rec.SFO["TITLE_ID"] != "PCSA00042" {
+		t.Errorf("task: manifest record missing SFO data: %v", rec.SFO)
+	}
+}
+
+func TestTaskManifestRecordsAllSfos(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZipMulti(t, fsys, "game.zip", map[string][]byte{
+		"game/sce_sys/param.sfo":       buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"),
+		"addon/dlc1/sce_sys/param.sfo": buildAddonParamSfo(t, "PCSA00042-DLC1", "gd"),
+	})
+
+	_, rec, err := task(context.Background(), fsys, false, testTemplate(t), &sync.Mutex{}, true, "game.zip")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if rec.SFO["TITLE_ID"] != "PCSA00042" {
+		t.Errorf("task: manifest record missing base game SFO data: %v", rec.SFO)
+	}
+	if rec.SFO["CONTENT_ID"] != "PCSA00042-DLC1" || rec.SFO["CATEGORY"] != "gd" {
+		t.Errorf("task: manifest record lost the add-on's SFO keys: %v", rec.SFO)
+	}
+}
+
+func TestTaskSkipsHashWhenNotNeeded(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "game.zip", buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"))
+
+	_, rec, err := task(context.Background(), fsys, false, testTemplate(t), &sync.Mutex{}, false, "game.zip")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if rec.SHA256 != "" {
+		t.Errorf("task: want no SHA256 computed when needHash=false, got %q", rec.SHA256)
+	}
+}
+
+func TestTaskRenamesZipInSubdirectory(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "USA/game.zip", buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"))
+
+	renamed, rec, err := task(context.Background(), fsys, false, testTemplate(t), &sync.Mutex{}, true, "USA/game.zip")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if !renamed {
+		t.Fatal("task: want renamed=true")
+	}
+
+	want := "USA/Gravity Rush (01.00-01.00-0) [PCSA00042] (USA).zip"
+	if ok, _ := afero.Exists(fsys, want); !ok {
+		t.Fatalf("expected renamed file %q to exist, kept in its own subdirectory", want)
+	}
+	if ok, _ := afero.Exists(fsys, "USA/game.zip"); ok {
+		t.Fatal("original USA/game.zip should no longer exist")
+	}
+	if rec == nil || rec.New != want {
+		t.Errorf("task: unexpected manifest record %+v", rec)
+	}
+}
+
+func TestTaskDryRunDoesNotRename(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "game.zip", buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"))
+
+	renamed, _, err := task(context.Background(), fsys, true, testTemplate(t), &sync.Mutex{}, true, "game.zip")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if !renamed {
+		t.Fatal("task: want renamed=true (preview)")
+	}
+
+	want := "Gravity Rush (01.00-01.00-0) [PCSA00042] (USA).zip"
+	if ok, _ := afero.Exists(fsys, want); ok {
+		t.Fatal("dry-run must not actually create the renamed file")
+	}
+	if ok, _ := afero.Exists(fsys, "game.zip"); !ok {
+		t.Fatal("dry-run must leave the original file in place")
+	}
+}
+
+func TestTaskSniffsUnknownExtensionAsZip(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "game.vpk", buildParamSfo(t, "Gravity Rush", "PCSA00042", "01.00"))
+
+	renamed, rec, err := task(context.Background(), fsys, false, testTemplate(t), &sync.Mutex{}, true, "game.vpk")
+	if err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if !renamed {
+		t.Fatal("task: want renamed=true")
+	}
+
+	want := "Gravity Rush (01.00-01.00-0) [PCSA00042] (USA).vpk"
+	if ok, _ := afero.Exists(fsys, want); !ok {
+		t.Fatalf("expected renamed file %q to exist", want)
+	}
+	if rec == nil || rec.New != want {
+		t.Errorf("task: unexpected manifest record %+v", rec)
+	}
+}
+
+func TestDiscoverFindsContainers(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "a.zip", buildParamSfo(t, "A", "PCSA00001", "01.00"))
+	if err := fsys.MkdirAll("extracted/sce_sys", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fsys, "extracted/sce_sys/param.sfo", buildParamSfo(t, "B", "PCSA00002", "01.00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("empty", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := discover(fsys, ".", defaultInclude, nil)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	found := map[string]bool{}
+	for _, f := range files {
+		found[f] = true
+	}
+	if !found["a.zip"] {
+		t.Errorf("discover: expected to find a.zip, got %v", files)
+	}
+	if !found["extracted"] {
+		t.Errorf("discover: expected to find extracted/, got %v", files)
+	}
+	if found["empty"] {
+		t.Errorf("discover: did not expect to find empty/, got %v", files)
+	}
+}
+
+func TestDiscoverExcludesPatterns(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	writeTestZip(t, fsys, "a.zip", buildParamSfo(t, "A", "PCSA00001", "01.00"))
+	if err := fsys.MkdirAll("backup/sce_sys", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fsys, "backup/sce_sys/param.sfo", buildParamSfo(t, "B", "PCSA00002", "01.00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := discover(fsys, ".", defaultInclude, []string{"backup/**"})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	for _, f := range files {
+		if f == "backup" {
+			t.Fatalf("discover: expected backup/ to be excluded, got %v", files)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestRecord documents a single rename: the container before and
+// after, every SFO key/value discovered in it, and a SHA256 of its
+// original bytes for later de-duplication.
+type manifestRecord struct {
+	Original string            `json:"original"`
+	New      string            `json:"new"`
+	Region   string            `json:"region"`
+	SHA256   string            `json:"sha256"`
+	SFO      map[string]string `json:"sfo"`
+}
+
+// manifestWriter durably records manifestRecords as they are produced.
+type manifestWriter interface {
+	write(rec manifestRecord) error
+	close() error
+}
+
+// newManifestWriter opens path and returns a writer in the format implied
+// by its extension: line-delimited JSON for ".json", CSV otherwise.
+func newManifestWriter(path string) (manifestWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return &jsonManifest{f: f, enc: json.NewEncoder(f)}, nil
+	}
+	return newCSVManifest(f)
+}
+
+// jsonManifest writes one JSON object per line (ndjson).
+type jsonManifest struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (m *jsonManifest) write(rec manifestRecord) error { return m.enc.Encode(rec) }
+
+func (m *jsonManifest) close() error { return m.f.Close() }
+
+// csvManifest writes one row per rename, with the SFO map flattened into
+// a single "key=value;key=value" column.
+type csvManifest struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func newCSVManifest(f *os.File) (*csvManifest, error) {
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"original", "new", "region", "sha256", "sfo"}); err != nil {
+		return nil, err
+	}
+	return &csvManifest{f: f, w: w}, nil
+}
+
+func (m *csvManifest) write(rec manifestRecord) error {
+	keys := make([]string, 0, len(rec.SFO))
+	for k := range rec.SFO {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, rec.SFO[k]))
+	}
+
+	if err := m.w.Write([]string{rec.Original, rec.New, rec.Region, rec.SHA256, strings.Join(pairs, ";")}); err != nil {
+		return err
+	}
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func (m *csvManifest) close() error { return m.f.Close() }
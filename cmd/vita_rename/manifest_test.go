@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := newManifestWriter(path)
+	if err != nil {
+		t.Fatalf("newManifestWriter: %v", err)
+	}
+	rec := manifestRecord{Original: "a.zip", New: "A (USA).zip", Region: "USA", SHA256: "deadbeef", SFO: map[string]string{"TITLE": "A"}}
+	if err := m.write(rec); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := m.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `"original":"a.zip"`) {
+		t.Errorf("manifest.json = %q, missing expected record", got)
+	}
+}
+
+func TestManifestCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.csv")
+	m, err := newManifestWriter(path)
+	if err != nil {
+		t.Fatalf("newManifestWriter: %v", err)
+	}
+	rec := manifestRecord{Original: "a.zip", New: "A (USA).zip", Region: "USA", SHA256: "deadbeef", SFO: map[string]string{"TITLE": "A"}}
+	if err := m.write(rec); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := m.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("manifest.csv: want 2 lines (header + record), got %d: %q", len(lines), got)
+	}
+	if !strings.Contains(lines[1], "a.zip") || !strings.Contains(lines[1], "TITLE=A") {
+		t.Errorf("manifest.csv record = %q, missing expected fields", lines[1])
+	}
+}
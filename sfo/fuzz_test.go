@@ -0,0 +1,29 @@
+package sfo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzParse checks that Parse never panics, no matter how malformed its
+// input is; truncated or hostile offsets must come back as an error.
+func FuzzParse(f *testing.F) {
+	seeds, err := filepath.Glob(filepath.Join("testdata", "*.sfo"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range seeds {
+		b, err := os.ReadFile(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add(buildSFO([]entry{{"TITLE", "Seed"}, {"TITLE_ID", "PCSB00001"}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Parse(bytes.NewReader(data))
+	})
+}
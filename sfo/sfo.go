@@ -0,0 +1,156 @@
+// Package sfo parses PlayStation Vita PARAM.SFO files.
+//
+// http://www.vitadevwiki.com/index.php?title=System_File_Object_(SFO)_(PSF)
+package sfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// magic is the little-endian "\x00PSF" value every valid SFO starts with.
+const magic = 1179865088
+
+// header is the fixed-size SFO header.
+type header struct {
+	Magic      int32 //   0:4
+	Version    int32 //   4:8
+	KeyOffset  int32 //  8:12
+	DataOffset int32 // 12:16
+	Entries    int32 // 16:20
+}
+
+// index is a single entry in the SFO index table.
+type index struct {
+	KeyOffset       int16 // 0x02
+	ParamFmt        int16 // 0x02
+	ParamLength     int32 // 0x04
+	ParamMaxLength  int32 // 0x04
+	DataTableOffset int32 // 0x04
+}
+
+// regions correlates a TITLE_ID prefix with its retail region, from
+// http://www.edepot.com/playstation.html and others.
+var regions = map[string]string{
+	"PCSB": "EUR", "VCES": "EUR", "VLES": "EUR", "PCSF": "EUR",
+	"PCSE": "USA", "PCSA": "USA", "PCSD": "USA", "VCUS": "USA", "VLUS": "USA",
+	"PCSG": "JAP", "PCSC": "JAP", "VCJS": "JAP", "VLJM": "JAP", "VLJS": "JAP",
+	"PCSH": "ASIA", "VCAS": "ASIA", "VLAS": "ASIA",
+}
+
+// File is a parsed PARAM.SFO document.
+type File struct {
+	values map[string]string
+}
+
+// Get returns the raw value stored under key, and whether it was present.
+func (f *File) Get(key string) (string, bool) {
+	v, ok := f.values[key]
+	return v, ok
+}
+
+// All returns every key/value pair discovered in the document, including
+// the derived REGION key.
+func (f *File) All() map[string]string {
+	m := make(map[string]string, len(f.values))
+	for k, v := range f.values {
+		m[k] = v
+	}
+	return m
+}
+
+// Region returns the region derived from TITLE_ID ("USA", "EUR", "JAP",
+// "ASIA"), or "UNK" if it could not be determined.
+func (f *File) Region() string {
+	return f.values["REGION"]
+}
+
+// Category returns the SFO CATEGORY value (e.g. "ac" for an add-on pack).
+func (f *File) Category() string {
+	return f.values["CATEGORY"]
+}
+
+// SafeString strips characters that are unsafe to use in a filename, so
+// it can also be used to sanitize values substituted into a caller's own
+// naming template.
+func SafeString(s string) string {
+	r := strings.NewReplacer(
+		"\000", "",
+		"\r", "",
+		"\n", "",
+		"\\", "",
+		"\"", "",
+		"/", "",
+		":", "",
+		"*", "",
+		"?", "",
+		"<", "",
+		">", "",
+		"|", "",
+	)
+
+	return r.Replace(s)
+}
+
+// Parse reads a PARAM.SFO document from r.
+func Parse(r io.Reader) (*File, error) {
+	sfob, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(sfob)
+}
+
+// FromFS opens name within fsys and parses it as a PARAM.SFO document, so
+// callers can hand in a zip.Reader, os.DirFS, embed.FS, or any other
+// fs.FS implementation.
+func FromFS(fsys fs.FS, name string) (*File, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func parse(sfob []byte) (*File, error) {
+	m := map[string]string{"REGION": "UNK"}
+	h := header{}
+	buffer := bytes.NewBuffer(sfob)
+	if err := binary.Read(buffer, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("sfo: reading header: %w", err)
+	}
+	if h.Magic != magic {
+		return nil, fmt.Errorf("sfo: invalid magic %#x", h.Magic)
+	}
+	if h.KeyOffset < 0 || h.DataOffset < h.KeyOffset || int(h.DataOffset) > len(sfob) {
+		return nil, fmt.Errorf("sfo: corrupt header offsets")
+	}
+
+	slice := bytes.Trim(sfob[h.KeyOffset:h.DataOffset], "\x00")
+	keys := bytes.Split(slice, []byte("\x00"))
+	for _, k := range keys {
+		i := index{}
+		if err := binary.Read(buffer, binary.LittleEndian, &i); err != nil {
+			return nil, fmt.Errorf("sfo: reading index table: %w", err)
+		}
+		start := int64(h.DataOffset) + int64(i.DataTableOffset)
+		end := start + int64(i.ParamLength)
+		if start < 0 || end < start || end > int64(len(sfob)) {
+			return nil, fmt.Errorf("sfo: corrupt value offsets for key %q", k)
+		}
+		key := string(k)
+		m[key] = SafeString(string(sfob[start:end]))
+		if tid, ok := m["TITLE_ID"]; ok && len(tid) >= 4 {
+			if reg, ok := regions[tid[0:4]]; ok {
+				m["REGION"] = reg
+			}
+		}
+	}
+
+	return &File{values: m}, nil
+}
@@ -0,0 +1,153 @@
+package sfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// entry is one key/value pair used to build a synthetic PARAM.SFO for
+// tests, in the order it should appear in the file.
+type entry struct {
+	key, value string
+}
+
+// buildSFO assembles a minimal, well-formed PARAM.SFO document containing
+// the given entries, in the on-disk layout real Vita tools produce:
+// header, index table, key table, data table.
+func buildSFO(entries []entry) []byte {
+	const headerSize = 20
+	const indexSize = 16
+
+	var keyTable bytes.Buffer
+	keyOffsets := make([]int32, len(entries))
+	for i, e := range entries {
+		keyOffsets[i] = int32(keyTable.Len())
+		keyTable.WriteString(e.key)
+		keyTable.WriteByte(0)
+	}
+
+	keyOffset := int32(headerSize + indexSize*len(entries))
+	dataOffset := keyOffset + int32(keyTable.Len())
+
+	var dataTable bytes.Buffer
+	indexes := make([]index, len(entries))
+	for i, e := range entries {
+		indexes[i] = index{
+			KeyOffset:       int16(keyOffsets[i]),
+			ParamFmt:        0x0204, // UTF-8, not NULL terminated
+			ParamLength:     int32(len(e.value)),
+			ParamMaxLength:  int32(len(e.value)),
+			DataTableOffset: int32(dataTable.Len()),
+		}
+		dataTable.WriteString(e.value)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header{
+		Magic:      magic,
+		Version:    0x00000101,
+		KeyOffset:  keyOffset,
+		DataOffset: dataOffset,
+		Entries:    int32(len(entries)),
+	})
+	for _, idx := range indexes {
+		binary.Write(&buf, binary.LittleEndian, idx)
+	}
+	buf.Write(keyTable.Bytes())
+	buf.Write(dataTable.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []entry
+		wantRegion string
+		wantGets   map[string]string
+	}{
+		{
+			name: "USA title",
+			entries: []entry{
+				{"TITLE", "Gravity Rush"},
+				{"TITLE_ID", "PCSA00042"},
+				{"APP_VER", "01.00"},
+				{"VERSION", "01.00"},
+				{"CATEGORY", "gd"},
+			},
+			wantRegion: "USA",
+			wantGets: map[string]string{
+				"TITLE":    "Gravity Rush",
+				"TITLE_ID": "PCSA00042",
+				"CATEGORY": "gd",
+			},
+		},
+		{
+			name: "unknown region",
+			entries: []entry{
+				{"TITLE", "Homebrew"},
+				{"TITLE_ID", "ZZZZ00001"},
+			},
+			wantRegion: "UNK",
+			wantGets: map[string]string{
+				"TITLE": "Homebrew",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(bytes.NewReader(buildSFO(tt.entries)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := f.Region(); got != tt.wantRegion {
+				t.Errorf("Region() = %q, want %q", got, tt.wantRegion)
+			}
+			for key, want := range tt.wantGets {
+				got, ok := f.Get(key)
+				if !ok {
+					t.Errorf("Get(%q): missing key", key)
+					continue
+				}
+				if got != want {
+					t.Errorf("Get(%q) = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileAll(t *testing.T) {
+	f, err := Parse(bytes.NewReader(buildSFO([]entry{
+		{"TITLE", "Gravity Rush"},
+		{"TITLE_ID", "PCSA00042"},
+	})))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	all := f.All()
+	if all["TITLE"] != "Gravity Rush" || all["TITLE_ID"] != "PCSA00042" || all["REGION"] != "USA" {
+		t.Fatalf("All() = %v, missing expected keys", all)
+	}
+}
+
+func TestParseInvalidMagic(t *testing.T) {
+	bad := make([]byte, 32)
+	if _, err := Parse(bytes.NewReader(bad)); err == nil {
+		t.Fatal("Parse: want error for invalid magic, got nil")
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	valid := buildSFO([]entry{{"TITLE", "Truncated"}, {"TITLE_ID", "PCSB00001"}})
+	for _, n := range []int{0, 4, 19, 20, 21} {
+		if n > len(valid) {
+			continue
+		}
+		if _, err := Parse(bytes.NewReader(valid[:n])); err == nil {
+			t.Errorf("Parse(%d bytes): want error, got nil", n)
+		}
+	}
+}